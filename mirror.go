@@ -8,6 +8,8 @@ import (
 	"github.com/kr/pretty"
 	cli "github.com/urfave/cli/v2"
 
+	"golang.org/x/net/context"
+
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 
@@ -44,9 +46,10 @@ func mirrorFunc(c *cli.Context) error {
 
 	mirrFS := mirrorfs.NewMirrorFS(
 		mirror,
-	).WithHook("*", func(data interface{}) {
+	).WithHook("*", func(ctx context.Context, event mirrorfs.Event) error {
 		fmt.Println("-----[running hook]-----")
-		pretty.Println(data)
+		pretty.Println(event)
+		return nil
 	})
 
 	err = fs.Serve(conn, mirrFS)
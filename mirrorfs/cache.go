@@ -0,0 +1,148 @@
+package mirrorfs
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+)
+
+// attrCacheEntry holds a cached stat result for a single path.
+type attrCacheEntry struct {
+	attr    fuse.Attr
+	kind    nodeKind
+	expires time.Time
+}
+
+// direntCacheEntry holds a cached directory listing for a single path.
+type direntCacheEntry struct {
+	entries []fuse.Dirent
+	expires time.Time
+}
+
+// attrCache is an in-memory, TTL-based cache of directory entries and stat
+// results, keyed by the mirrored path on the underlying filesystem. Entries
+// are re-stat'd on expiry rather than served stale, and the cache is safe
+// for concurrent use via its RWMutex. A nil *attrCache is a valid, always-miss
+// cache so callers never need to nil-check before use.
+type attrCache struct {
+	mu      sync.RWMutex
+	timeout time.Duration
+	hooks   HookHandler
+
+	attrs   map[string]attrCacheEntry
+	dirents map[string]direntCacheEntry
+}
+
+// newAttrCache creates an attrCache that expires entries after timeout. A
+// non-positive timeout disables caching: every lookup is reported as a miss.
+func newAttrCache(timeout time.Duration, hooks HookHandler) *attrCache {
+	return &attrCache{
+		timeout: timeout,
+		hooks:   hooks,
+		attrs:   map[string]attrCacheEntry{},
+		dirents: map[string]direntCacheEntry{},
+	}
+}
+
+func (c *attrCache) getAttr(ctx context.Context, key string) (fuse.Attr, nodeKind, bool) {
+	if c == nil || c.timeout <= 0 {
+		return fuse.Attr{}, kindFile, false
+	}
+
+	c.mu.RLock()
+	entry, ok := c.attrs[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "miss", Kind: "attr", Key: key})
+		return fuse.Attr{}, kindFile, false
+	}
+
+	c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "hit", Kind: "attr", Key: key})
+	return entry.attr, entry.kind, true
+}
+
+func (c *attrCache) putAttr(key string, attr fuse.Attr, kind nodeKind) {
+	if c == nil || c.timeout <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.attrs[key] = attrCacheEntry{
+		attr:    attr,
+		kind:    kind,
+		expires: time.Now().Add(c.timeout),
+	}
+	c.mu.Unlock()
+}
+
+func (c *attrCache) getDirents(ctx context.Context, key string) ([]fuse.Dirent, bool) {
+	if c == nil || c.timeout <= 0 {
+		return nil, false
+	}
+
+	c.mu.RLock()
+	entry, ok := c.dirents[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "miss", Kind: "dirents", Key: key})
+		return nil, false
+	}
+
+	c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "hit", Kind: "dirents", Key: key})
+	return entry.entries, true
+}
+
+func (c *attrCache) putDirents(key string, entries []fuse.Dirent) {
+	if c == nil || c.timeout <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.dirents[key] = direntCacheEntry{
+		entries: entries,
+		expires: time.Now().Add(c.timeout),
+	}
+	c.mu.Unlock()
+}
+
+// forgetPrefix drops every cached entry at prefix or nested beneath it.
+func (c *attrCache) forgetPrefix(ctx context.Context, prefix string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for key := range c.attrs {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			delete(c.attrs, key)
+		}
+	}
+	for key := range c.dirents {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			delete(c.dirents, key)
+		}
+	}
+	c.mu.Unlock()
+
+	c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "forget", Key: prefix})
+}
+
+// forgetAll drops every cached entry.
+func (c *attrCache) forgetAll(ctx context.Context) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.attrs = map[string]attrCacheEntry{}
+	c.dirents = map[string]direntCacheEntry{}
+	c.mu.Unlock()
+
+	c.hooks.HandlePost(ctx, &CacheEvent{Outcome: "forget", Key: "*"})
+}
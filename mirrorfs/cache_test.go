@@ -0,0 +1,177 @@
+package mirrorfs
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+)
+
+func TestAttrCacheGetAttr(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		prime   bool
+		sleep   time.Duration
+		wantOk  bool
+	}{
+		{name: "miss on empty cache", timeout: time.Hour, wantOk: false},
+		{name: "hit on fresh entry", timeout: time.Hour, prime: true, wantOk: true},
+		{name: "miss on expired entry", timeout: time.Millisecond, prime: true, sleep: 10 * time.Millisecond, wantOk: false},
+		{name: "miss when caching disabled", timeout: 0, prime: true, wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newAttrCache(tt.timeout, NewHookHandler())
+
+			if tt.prime {
+				c.putAttr("/a", fuse.Attr{Size: 42}, kindDir)
+			}
+			if tt.sleep > 0 {
+				time.Sleep(tt.sleep)
+			}
+
+			attr, kind, ok := c.getAttr(context.Background(), "/a")
+			if ok != tt.wantOk {
+				t.Fatalf("getAttr ok = %v, want %v", ok, tt.wantOk)
+			}
+			if tt.wantOk {
+				if attr.Size != 42 {
+					t.Errorf("attr.Size = %d, want 42", attr.Size)
+				}
+				if kind != kindDir {
+					t.Errorf("kind = %v, want %v", kind, kindDir)
+				}
+			}
+		})
+	}
+}
+
+func TestAttrCacheGetDirents(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		prime   bool
+		sleep   time.Duration
+		wantOk  bool
+	}{
+		{name: "miss on empty cache", timeout: time.Hour, wantOk: false},
+		{name: "hit on fresh entry", timeout: time.Hour, prime: true, wantOk: true},
+		{name: "miss on expired entry", timeout: time.Millisecond, prime: true, sleep: 10 * time.Millisecond, wantOk: false},
+		{name: "miss when caching disabled", timeout: 0, prime: true, wantOk: false},
+	}
+
+	entries := []fuse.Dirent{{Name: "foo"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newAttrCache(tt.timeout, NewHookHandler())
+
+			if tt.prime {
+				c.putDirents("/a", entries)
+			}
+			if tt.sleep > 0 {
+				time.Sleep(tt.sleep)
+			}
+
+			got, ok := c.getDirents(context.Background(), "/a")
+			if ok != tt.wantOk {
+				t.Fatalf("getDirents ok = %v, want %v", ok, tt.wantOk)
+			}
+			if tt.wantOk && (len(got) != 1 || got[0].Name != "foo") {
+				t.Errorf("getDirents entries = %v, want %v", got, entries)
+			}
+		})
+	}
+}
+
+func TestAttrCacheForgetPrefix(t *testing.T) {
+	c := newAttrCache(time.Hour, NewHookHandler())
+
+	c.putAttr("/a", fuse.Attr{}, kindDir)
+	c.putAttr("/a/b", fuse.Attr{}, kindFile)
+	c.putAttr("/other", fuse.Attr{}, kindFile)
+	c.putDirents("/a", nil)
+	c.putDirents("/other", nil)
+
+	c.forgetPrefix(context.Background(), "/a")
+
+	if _, _, ok := c.getAttr(context.Background(), "/a"); ok {
+		t.Error("expected /a to be forgotten")
+	}
+	if _, _, ok := c.getAttr(context.Background(), "/a/b"); ok {
+		t.Error("expected /a/b to be forgotten as a child of /a")
+	}
+	if _, ok := c.getDirents(context.Background(), "/a"); ok {
+		t.Error("expected dirents for /a to be forgotten")
+	}
+	if _, _, ok := c.getAttr(context.Background(), "/other"); !ok {
+		t.Error("expected /other to survive forgetPrefix(/a)")
+	}
+	if _, ok := c.getDirents(context.Background(), "/other"); !ok {
+		t.Error("expected dirents for /other to survive forgetPrefix(/a)")
+	}
+}
+
+func TestAttrCacheForgetAll(t *testing.T) {
+	c := newAttrCache(time.Hour, NewHookHandler())
+
+	c.putAttr("/a", fuse.Attr{}, kindDir)
+	c.putDirents("/a", nil)
+
+	c.forgetAll(context.Background())
+
+	if _, _, ok := c.getAttr(context.Background(), "/a"); ok {
+		t.Error("expected /a to be forgotten")
+	}
+	if _, ok := c.getDirents(context.Background(), "/a"); ok {
+		t.Error("expected dirents for /a to be forgotten")
+	}
+}
+
+func TestAttrCacheNilReceiverIsAlwaysMiss(t *testing.T) {
+	var c *attrCache
+
+	if _, _, ok := c.getAttr(context.Background(), "/a"); ok {
+		t.Error("nil *attrCache.getAttr should always miss")
+	}
+	if _, ok := c.getDirents(context.Background(), "/a"); ok {
+		t.Error("nil *attrCache.getDirents should always miss")
+	}
+
+	// None of these should panic on a nil receiver.
+	c.putAttr("/a", fuse.Attr{}, kindFile)
+	c.putDirents("/a", nil)
+	c.forgetPrefix(context.Background(), "/a")
+	c.forgetAll(context.Background())
+}
+
+func TestAttrCacheEmitsCacheEvents(t *testing.T) {
+	var outcomes []string
+
+	hooks := NewHookHandler()
+	hooks.Register("cache:*", func(ctx context.Context, event Event) error {
+		outcomes = append(outcomes, event.EventName())
+		return nil
+	})
+
+	c := newAttrCache(time.Hour, hooks)
+
+	c.getAttr(context.Background(), "/a")
+	c.putAttr("/a", fuse.Attr{}, kindFile)
+	c.getAttr(context.Background(), "/a")
+	c.forgetPrefix(context.Background(), "/a")
+
+	want := []string{"cache:miss", "cache:hit", "cache:forget"}
+	if len(outcomes) != len(want) {
+		t.Fatalf("outcomes = %v, want %v", outcomes, want)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("outcomes[%d] = %q, want %q", i, outcomes[i], want[i])
+		}
+	}
+}
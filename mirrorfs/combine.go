@@ -0,0 +1,187 @@
+package mirrorfs
+
+import (
+	"os"
+	"sort"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// comboDir is the virtual root of a combine mirror. Unlike dir, it has no
+// single backing path on disk; each of its entries is a named upstream root
+// that Lookup/ReadDirAll route requests to.
+type comboDir struct {
+	HookHandler
+
+	upstreams UpstreamMap
+	collision CollisionPolicy
+	cfg       *fsConfig
+}
+
+// DirectoryFactory overrides the HookHandler-promoted factory so that the
+// dirs backing each upstream root share the combine mirror's fsConfig
+// (attribute cache, read-only mode, etc).
+func (cd *comboDir) DirectoryFactory() DirectoryFactory {
+	return NewDirectoryFactoryWithConfig(cd.HookHandler, cd.cfg)
+}
+
+// FileFactory overrides the HookHandler-promoted factory so that files
+// created via the combine root share the same fsConfig.
+func (cd *comboDir) FileFactory() FileFactory {
+	return NewFileFactoryWithConfig(cd.HookHandler, cd.cfg)
+}
+
+// routeEvent fires an "upstream:route" hook event recording which backing
+// root served the given operation.
+func (cd *comboDir) routeEvent(ctx context.Context, op, name, path string) {
+	cd.HandlePost(ctx, &UpstreamRouteEvent{Op: op, Name: name, Path: path})
+}
+
+// Attr sets the attributes for the combine root. It has no single backing
+// path, so it is reported as a synthetic, read-write directory.
+func (cd *comboDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	if err := cd.HandlePre(ctx, &AttrEvent{Phase: "start"}); err != nil {
+		return err
+	}
+
+	a.Mode = os.ModeDir | 0755
+
+	cd.HandlePost(ctx, &AttrEvent{Phase: "end"})
+
+	return nil
+}
+
+// Lookup resolves a top-level name to the dir backing its matching upstream
+// root.
+func (cd *comboDir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	if err := cd.HandlePre(ctx, &LookupEvent{Phase: "start", Name: req.Name}); err != nil {
+		return nil, err
+	}
+
+	upstreamPath, ok := cd.upstreams[req.Name]
+	if !ok {
+		cd.HandlePost(ctx, &LookupEvent{Phase: "end", Name: req.Name, Err: syscall.ENOENT})
+		return nil, syscall.ENOENT
+	}
+
+	node := cd.DirectoryFactory().NewDirectory(upstreamPath)
+	if err := node.Attr(ctx, &resp.Attr); err != nil {
+		cd.HandlePost(ctx, &LookupEvent{Phase: "end", Name: req.Name, Err: err})
+		return nil, err
+	}
+
+	cd.routeEvent(ctx, "Lookup", req.Name, upstreamPath)
+
+	cd.HandlePost(ctx, &LookupEvent{Phase: "end", Name: req.Name, Result: node})
+
+	return node, nil
+}
+
+// ReadDirAll lists every configured upstream as a top-level directory entry.
+func (cd *comboDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := cd.HandlePre(ctx, &ReadDirAllEvent{Phase: "start"}); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(cd.upstreams))
+	for name := range cd.upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]fuse.Dirent, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fuse.Dirent{
+			Name: name,
+			Type: fuse.DT_Dir,
+		})
+		cd.routeEvent(ctx, "ReadDirAll", name, cd.upstreams[name])
+	}
+
+	cd.HandlePost(ctx, &ReadDirAllEvent{Phase: "end", Entries: entries})
+
+	return entries, nil
+}
+
+// Mkdir only supports re-resolving a name that already matches a configured
+// upstream; the combine root cannot add brand new upstream roots at runtime.
+func (cd *comboDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if err := cd.HandlePre(ctx, &MkdirEvent{Phase: "start", Name: req.Name}); err != nil {
+		return nil, err
+	}
+
+	if cd.cfg.readOnly {
+		cd.HandlePost(ctx, &MkdirEvent{Phase: "end", Name: req.Name, Err: fuse.Errno(syscall.EACCES)})
+		return nil, fuse.Errno(syscall.EACCES)
+	}
+
+	upstreamPath, ok := cd.upstreams[req.Name]
+	if !ok {
+		cd.HandlePost(ctx, &MkdirEvent{Phase: "end", Name: req.Name, Err: syscall.EPERM})
+		return nil, syscall.EPERM
+	}
+
+	cd.routeEvent(ctx, "Mkdir", req.Name, upstreamPath)
+
+	if cd.collision == ErrorOnCollision {
+		cd.HandlePost(ctx, &MkdirEvent{Phase: "end", Name: req.Name, Err: syscall.EEXIST})
+		return nil, syscall.EEXIST
+	}
+
+	node := cd.DirectoryFactory().NewDirectory(upstreamPath)
+
+	cd.HandlePost(ctx, &MkdirEvent{Phase: "end", Name: req.Name, Node: node})
+
+	return node, nil
+}
+
+// Create never adds a file at the combine root: a name matching a configured
+// upstream fails with EISDIR, and any other name fails with EPERM.
+func (cd *comboDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	if err := cd.HandlePre(ctx, &CreateEvent{Phase: "start", Name: req.Name}); err != nil {
+		return nil, nil, err
+	}
+
+	if cd.cfg.readOnly {
+		cd.HandlePost(ctx, &CreateEvent{Phase: "end", Name: req.Name, Err: fuse.Errno(syscall.EACCES)})
+		return nil, nil, fuse.Errno(syscall.EACCES)
+	}
+
+	upstreamPath, ok := cd.upstreams[req.Name]
+	if !ok {
+		cd.HandlePost(ctx, &CreateEvent{Phase: "end", Name: req.Name, Err: syscall.EPERM})
+		return nil, nil, syscall.EPERM
+	}
+
+	cd.routeEvent(ctx, "Create", req.Name, upstreamPath)
+
+	// The name collides with a configured upstream root, which is a
+	// directory, not a file: there is no file node to hand back.
+	cd.HandlePost(ctx, &CreateEvent{Phase: "end", Name: req.Name, Err: syscall.EISDIR})
+	return nil, nil, syscall.EISDIR
+}
+
+// Remove is unsupported at the combine root: upstream mappings are
+// configured, not deletable entries.
+func (cd *comboDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if err := cd.HandlePre(ctx, &RemoveEvent{Phase: "start", Name: req.Name}); err != nil {
+		return err
+	}
+
+	if cd.cfg.readOnly {
+		cd.HandlePost(ctx, &RemoveEvent{Phase: "end", Name: req.Name, Err: fuse.Errno(syscall.EACCES)})
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	if upstreamPath, ok := cd.upstreams[req.Name]; ok {
+		cd.routeEvent(ctx, "Remove", req.Name, upstreamPath)
+	}
+
+	cd.HandlePost(ctx, &RemoveEvent{Phase: "end", Name: req.Name, Err: syscall.EPERM})
+
+	return syscall.EPERM
+}
@@ -7,22 +7,16 @@ import (
 	"syscall"
 
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 )
 
-// EventHandler is our interface for ensuring a receiver can handle events.
-type EventHandler interface {
-	HandleEvent(event string, data interface{})
-}
-
 // Directory is our contract for what it means to be a directory.
 type Directory interface {
 	fs.Node
 	fs.Handle
-
-	EventHandler
 }
 
 // DirectoryFactory is our utility for creating new Directories.
@@ -34,6 +28,7 @@ type DirectoryFactory interface {
 // internal hooks.
 type directoryFactory struct {
 	hooks HookHandler
+	cfg   *fsConfig
 }
 
 // NewDirectoryFactory creates a new DirectoryFactory with the given
@@ -41,6 +36,16 @@ type directoryFactory struct {
 func NewDirectoryFactory(hh HookHandler) DirectoryFactory {
 	return &directoryFactory{
 		hooks: hh,
+		cfg:   &fsConfig{},
+	}
+}
+
+// NewDirectoryFactoryWithConfig creates a new DirectoryFactory with the given
+// HookHandler whose directories share the given fsConfig.
+func NewDirectoryFactoryWithConfig(hh HookHandler, cfg *fsConfig) DirectoryFactory {
+	return &directoryFactory{
+		hooks: hh,
+		cfg:   cfg,
 	}
 }
 
@@ -50,6 +55,7 @@ func (df *directoryFactory) NewDirectory(path string) Directory {
 	return &dir{
 		path:        path,
 		HookHandler: df.hooks,
+		cfg:         df.cfg,
 	}
 }
 
@@ -58,12 +64,67 @@ type dir struct {
 	HookHandler
 
 	path string
+	cfg  *fsConfig
 }
 
-// HandleEvent delegates handling of the event and its data to our internal
-// HookHandler.
-func (d *dir) HandleEvent(event string, data interface{}) {
-	d.HookHandler.Handle(event, data)
+// DirectoryFactory overrides the HookHandler-promoted factory so that child
+// directories created from this one share the same fsConfig (attribute cache,
+// read-only mode, etc).
+func (d *dir) DirectoryFactory() DirectoryFactory {
+	return NewDirectoryFactoryWithConfig(d.HookHandler, d.cfg)
+}
+
+// FileFactory overrides the HookHandler-promoted factory so that files
+// created from this directory share the same fsConfig.
+func (d *dir) FileFactory() FileFactory {
+	return NewFileFactoryWithConfig(d.HookHandler, d.cfg)
+}
+
+// ForgetAll drops every cached directory listing and stat result reachable
+// from this FS tree.
+func (d *dir) ForgetAll() {
+	d.cfg.cache.forgetAll(context.Background())
+}
+
+// ForgetPath drops the cached entry for the given path, relative to this
+// directory, along with any cached descendants.
+func (d *dir) ForgetPath(rel string) {
+	d.cfg.cache.forgetPrefix(context.Background(), filepath.Join(d.path, rel))
+}
+
+// nodeKind records which concrete node type backs a cached path, since
+// Lookup must be able to reconstruct the right node type on a cache hit
+// without re-stat'ing.
+type nodeKind int
+
+const (
+	kindFile nodeKind = iota
+	kindDir
+	kindSymlink
+)
+
+// kindOf classifies a Lstat'd os.FileInfo into a nodeKind.
+func kindOf(fileInfo os.FileInfo) nodeKind {
+	switch {
+	case fileInfo.Mode()&os.ModeSymlink != 0:
+		return kindSymlink
+	case fileInfo.IsDir():
+		return kindDir
+	default:
+		return kindFile
+	}
+}
+
+// newNodeOfKind constructs the node type matching kind for the given path.
+func (d *dir) newNodeOfKind(path string, kind nodeKind) fs.Node {
+	switch kind {
+	case kindDir:
+		return d.DirectoryFactory().NewDirectory(path)
+	case kindSymlink:
+		return &symlink{HookHandler: d.HookHandler, path: path}
+	default:
+		return d.FileFactory().NewFile(path)
+	}
 }
 
 // Attr sets the attributes for the receiving directory on the given `fuse.Attr`.
@@ -81,16 +142,17 @@ func (d *dir) Attr(ctx context.Context, a *fuse.Attr) error {
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("attr:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"attr":      a,
-	})
+	if err := d.HandlePre(ctx, &AttrEvent{Phase: "start", Dir: d}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
 
 	fileInfo, err := os.Stat(d.path)
 	if err != nil {
+		translated := d.translate(ctx, err)
+		d.HandlePost(ctx, &AttrEvent{Phase: "end", Dir: d, Err: translated})
 		lgrEnd(d, err)
-		return syscall.ENOENT
+		return translated
 	}
 
 	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
@@ -101,11 +163,7 @@ func (d *dir) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = stat.Ino
 	a.Mode = fileInfo.Mode()
 
-	d.Handle("attr:end", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"attr":      a,
-	})
+	d.HandlePost(ctx, &AttrEvent{Phase: "end", Dir: d})
 
 	lgrEnd(d, ctx, a)
 	return nil
@@ -128,43 +186,50 @@ func (d *dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("Lookup:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"req":       req,
-		"resp":      resp,
-	})
+	if err := d.HandlePre(ctx, &LookupEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, nil, err)
+		return nil, err
+	}
 
 	fullPath := filepath.Join(
 		d.path,
 		req.Name,
 	)
 
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
-		lgrEnd(d, nil, err)
-		return nil, syscall.ENOENT
+	var node fs.Node
+	if attr, kind, ok := d.cfg.cache.getAttr(ctx, fullPath); ok {
+		resp.Attr = attr
+		node = d.newNodeOfKind(fullPath, kind)
+
+		lgrEnd(d, node, nil)
+
+		d.HandlePost(ctx, &LookupEvent{Phase: "end", Dir: d, Name: req.Name, Result: node})
+
+		return node, nil
 	}
 
-	var node fs.Node
-	if fileInfo.IsDir() {
-		node = d.DirectoryFactory().NewDirectory(fullPath)
-	} else {
-		node = d.FileFactory().NewFile(fullPath)
+	fileInfo, err := os.Lstat(fullPath)
+	if err != nil {
+		translated := d.translate(ctx, err)
+		d.HandlePost(ctx, &LookupEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+		lgrEnd(d, nil, translated)
+		return nil, translated
 	}
 
+	kind := kindOf(fileInfo)
+	node = d.newNodeOfKind(fullPath, kind)
+
 	if err := node.Attr(ctx, &resp.Attr); err != nil {
+		d.HandlePost(ctx, &LookupEvent{Phase: "end", Dir: d, Name: req.Name, Err: err})
 		lgrEnd(d, nil, err)
 		return nil, err
 	}
 
+	d.cfg.cache.putAttr(fullPath, resp.Attr, kind)
+
 	lgrEnd(d, node, nil)
 
-	d.Handle("Lookup:end", map[string]interface{}{
-		"directory": d,
-		"node":      node,
-		"error":     nil,
-	})
+	d.HandlePost(ctx, &LookupEvent{Phase: "end", Dir: d, Name: req.Name, Result: node})
 
 	return node, nil
 }
@@ -183,21 +248,25 @@ func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("ReadDirAll:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-	})
+	if err := d.HandlePre(ctx, &ReadDirAllEvent{Phase: "start", Dir: d}); err != nil {
+		lgrEnd(d, nil, err)
+		return nil, err
+	}
+
+	if cached, ok := d.cfg.cache.getDirents(ctx, d.path); ok {
+		d.HandlePost(ctx, &ReadDirAllEvent{Phase: "end", Dir: d, Entries: cached})
+
+		lgrEnd(d, cached, nil)
+		return cached, nil
+	}
 
 	entries, err := ioutil.ReadDir(d.path)
 	if err != nil {
-		d.Handle("ReadDirAll:end", map[string]interface{}{
-			"directory": d,
-			"entries":   entries,
-			"error":     err,
-		})
+		translated := d.translate(ctx, err)
+		d.HandlePost(ctx, &ReadDirAllEvent{Phase: "end", Dir: d, Err: translated})
 
-		lgrEnd(d, nil, err)
-		return nil, err
+		lgrEnd(d, nil, translated)
+		return nil, translated
 	}
 
 	var toReturn = make([]fuse.Dirent, len(entries))
@@ -206,7 +275,6 @@ func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		newEntry := fuse.Dirent{
 			Name: entry.Name(),
 		}
-		toReturn[i] = newEntry
 
 		stat, ok := entry.Sys().(*syscall.Stat_t)
 		if ok {
@@ -217,18 +285,21 @@ func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		}
 
 		// TODO(ttacon): handle all the other types (sockets, etc)
-		if entry.IsDir() {
+		switch kindOf(entry) {
+		case kindDir:
 			newEntry.Type = fuse.DT_Dir
-		} else {
+		case kindSymlink:
+			newEntry.Type = fuse.DT_Link
+		default:
 			newEntry.Type = fuse.DT_File
 		}
+
+		toReturn[i] = newEntry
 	}
 
-	d.Handle("ReadDirAll:end", map[string]interface{}{
-		"directory": d,
-		"entries":   entries,
-		"error":     nil,
-	})
+	d.cfg.cache.putDirents(d.path, toReturn)
+
+	d.HandlePost(ctx, &ReadDirAllEvent{Phase: "end", Dir: d, Entries: toReturn})
 
 	lgrEnd(d, toReturn, nil)
 	return toReturn, nil
@@ -250,12 +321,10 @@ func (d *dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("Setattr:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"request":   req,
-		"response":  resp,
-	})
+	if err := d.HandlePre(ctx, &SetattrEvent{Phase: "start", Dir: d, Request: req}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
 
 	// We need to:
 	//
@@ -267,12 +336,7 @@ func (d *dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.
 	//   - resp.Attr.Size = uint64(d.Entry.Stat.Size)
 	//   - resp.Attr.Uid = d.Entry.Stat.Uid
 	//   - resp.Attr.Gid = d.Entry.Stat.Gid
-	d.Handle("Setattr:end", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"request":   req,
-		"response":  resp,
-	})
+	d.HandlePost(ctx, &SetattrEvent{Phase: "end", Dir: d, Request: req})
 
 	lgrEnd(d, nil)
 	return nil
@@ -292,37 +356,50 @@ func (d *dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("Create:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"request":   req,
-		"response":  resp,
-	})
+	if err := d.HandlePre(ctx, &CreateEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, nil, nil, err)
+		return nil, nil, err
+	}
 
-	f, err := os.OpenFile(
-		req.Name,
+	if d.cfg.readOnly {
+		lgrEnd(d, nil, nil, syscall.EACCES)
+		return nil, nil, fuse.Errno(syscall.EACCES)
+	}
+
+	fullPath := filepath.Join(d.path, req.Name)
+
+	osFile, err := os.OpenFile(
+		fullPath,
 		int(req.Flags),
 		req.Mode,
 	)
 	if err != nil {
-		lgrEnd(d, nil, nil, err)
-		return nil, nil, err
-	} else if err := f.Close(); err != nil {
-		lgrEnd(d, nil, nil, err)
-		return nil, nil, err
+		translated := d.translate(ctx, err)
+		d.HandlePost(ctx, &CreateEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+		lgrEnd(d, nil, nil, translated)
+		return nil, nil, translated
 	}
-	d.Handle("Create:end", map[string]interface{}{
-		"directory": d,
-		"node":      nil,
-		"handle":    nil,
-		"error":     nil,
-	})
 
-	file := d.FileFactory().NewFile(req.Name)
+	d.cfg.cache.forgetPrefix(ctx, d.path)
 
-	lgrEnd(d, file, file, nil)
+	node := d.FileFactory().NewFile(fullPath)
+	f, ok := node.(*file)
+	if !ok {
+		lgrEnd(d, nil, nil, syscall.EINVAL)
+		return nil, nil, syscall.EINVAL
+	}
+
+	handle := &fileHandle{
+		HookHandler: f.HookHandler,
+		file:        f,
+		osFile:      osFile,
+	}
+
+	d.HandlePost(ctx, &CreateEvent{Phase: "end", Dir: d, Name: req.Name, Node: node})
 
-	return file, file, nil
+	lgrEnd(d, node, handle, nil)
+
+	return node, handle, nil
 }
 
 func (d *dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
@@ -339,21 +416,25 @@ func (d *dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("Remove:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"request":   req,
-	})
+	if err := d.HandlePre(ctx, &RemoveEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
 
-	err := os.Remove(req.Name)
+	err := os.Remove(filepath.Join(d.path, req.Name))
+	translated := d.translate(ctx, err)
 
-	d.Handle("Remove:end", map[string]interface{}{
-		"directory": d,
-		"error":     err,
-	})
-	lgrEnd(d, err)
+	d.cfg.cache.forgetPrefix(ctx, d.path)
 
-	return err
+	d.HandlePost(ctx, &RemoveEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+	lgrEnd(d, translated)
+
+	return translated
 }
 
 func (d *dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
@@ -370,11 +451,15 @@ func (d *dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 		lgr.Debug("end", data)
 	}
 
-	d.Handle("Mkdir:start", map[string]interface{}{
-		"directory": d,
-		"context":   ctx,
-		"request":   req,
-	})
+	if err := d.HandlePre(ctx, &MkdirEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, nil, err)
+		return nil, err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, nil, fuse.Errno(syscall.EACCES))
+		return nil, fuse.Errno(syscall.EACCES)
+	}
 
 	fullPath := filepath.Join(
 		d.path,
@@ -382,103 +467,278 @@ func (d *dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	)
 
 	if err := os.Mkdir(fullPath, req.Mode); err != nil {
-		d.Handle("Mkdir:end", map[string]interface{}{
-			"directory": d,
-			"node":      nil,
-			"error":     nil,
-		})
+		translated := d.translate(ctx, err)
+		d.HandlePost(ctx, &MkdirEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
 
-		lgrEnd(d, nil, err)
-		return nil, err
+		lgrEnd(d, nil, translated)
+		return nil, translated
 	}
 
+	d.cfg.cache.forgetPrefix(ctx, d.path)
+
 	node := d.DirectoryFactory().NewDirectory(fullPath)
 
-	d.Handle("Mkdir:end", map[string]interface{}{
-		"directory": d,
-		"node":      node,
-		"error":     nil,
-	})
+	d.HandlePost(ctx, &MkdirEvent{Phase: "end", Dir: d, Name: req.Name, Node: node})
 
 	lgrEnd(d, node, nil)
 
 	return node, nil
 }
 
-//
-// XXX Should we handle Rename ???
-// If yes, how do we treat the files - as new or just the old ones?
-// Just the old ones is not good. Cannot get from remote as names changed and
-// we are not keeping track of remote names separately. We might, if we need this functionality
-//
-/* COMMENTED OUT FOR NOW!!
-func (d *DIR) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
-	var oldPrefix, newPrefix string
-	nd, ok := newDir.(*DIR)
+// Rename moves req.OldName out of the receiving directory into newDir under
+// req.NewName.
+func (d *dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Rename",
+	})
+	lgr.Debug("start", []interface{}{
+		d,
+		ctx,
+		req,
+		newDir,
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	nd, ok := newDir.(*dir)
 	if !ok {
-		log.WithFields(log.Fields{"newDir": newDir}).Error("Rename: New Dir is not a DIR")
-		return syscall.EINVAL	// Should we fix fuse.error ???
-	}
-	if d.Entry.Prefix != "" {
-		oldPrefix = d.Entry.Prefix + "/" + d.Entry.Name
-	} else {
-		oldPrefix = d.Entry.Name
-	}
-	if nd.Entry.Prefix != "" {
-		newPrefix = nd.Entry.Prefix + "/" + nd.Entry.Name
-	} else {
-		newPrefix = nd.Entry.Name
-	}
-	log.WithFields(log.Fields{"Dir": d, "newDir": nd, "Request": req,
-			  "Old Prefix": oldPrefix, "New Prefix": newPrefix,
-		}).Error("Rename request")
-	//XXX
-	//XXX Do the locking properly, when we do support rename
-	d.RData.lock.Lock()
-	foundDir := false
-	idx := -1
-	for i, ent := range d.RData.Meta.Entries {
-		if ent.Prefix == oldPrefix && ent.Name == req.OldName {
-			if ent.IsDir == false {
-				d.RData.Meta.Entries[i].Prefix = newPrefix
-				d.RData.Meta.Entries[i].Name = req.NewName
-				d.Entry = d.RData.Meta.Entries[i]
-				d.RData.lock.Unlock()
-				//XXX We are not verifying the New Dir to be part of Meta.Entries now..
-				//XXX Is it even possible? I guess not as it will be lookuped up before
-				//XXX this is called...
-				if err := saveMeta(d.Acc, d.RData); err != nil {
-					log.Error("Rename file: cannot save Meta")
-					return err
-				}
-				return nil
-			} else {
-				foundDir = true
-				idx = i
-				break
-			}
-		}
+		lgrEnd(d, syscall.EINVAL)
+		return syscall.EINVAL
 	}
-	if !foundDir {
-		d.RData.lock.Unlock()
-		return syscall.ENOENT
-	}
-	// Rename a dir
-	d.RData.Meta.Entries[idx].Prefix = newPrefix
-	d.RData.Meta.Entries[idx].Name = req.NewName
-	d.Entry = d.RData.Meta.Entries[idx]
-	oldPrefix = oldPrefix + "/" + req.OldName
-	newPrefix = newPrefix + "/" + req.NewName
-	for i, e2 := range d.RData.Meta.Entries {
-		if e2.Prefix == oldPrefix {
-			d.RData.Meta.Entries[i].Prefix = newPrefix
-		}
+
+	oldPath := filepath.Join(d.path, req.OldName)
+	newPath := filepath.Join(nd.path, req.NewName)
+
+	if err := d.HandlePre(ctx, &RenameEvent{Phase: "start", Dir: d, OldPath: oldPath, NewPath: newPath}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	err := os.Rename(oldPath, newPath)
+	translated := d.translate(ctx, err)
+
+	d.cfg.cache.forgetPrefix(ctx, d.path)
+	d.cfg.cache.forgetPrefix(ctx, nd.path)
+
+	d.HandlePost(ctx, &RenameEvent{Phase: "end", Dir: d, OldPath: oldPath, NewPath: newPath, Err: translated})
+
+	lgrEnd(d, translated)
+
+	return translated
+}
+
+// Symlink creates a new symbolic link named req.NewName in the receiving
+// directory, pointing at req.Target.
+func (d *dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Symlink",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	fullPath := filepath.Join(d.path, req.NewName)
+
+	if err := d.HandlePre(ctx, &SymlinkEvent{Phase: "start", Dir: d, Name: req.NewName, Target: req.Target}); err != nil {
+		lgrEnd(d, nil, err)
+		return nil, err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, nil, fuse.Errno(syscall.EACCES))
+		return nil, fuse.Errno(syscall.EACCES)
+	}
+
+	err := os.Symlink(req.Target, fullPath)
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &SymlinkEvent{Phase: "end", Dir: d, Name: req.NewName, Target: req.Target, Err: translated})
+
+	if err != nil {
+		lgrEnd(d, nil, translated)
+		return nil, translated
+	}
+
+	d.cfg.cache.forgetPrefix(ctx, d.path)
+
+	node := &symlink{HookHandler: d.HookHandler, path: fullPath}
+
+	lgrEnd(d, node, nil)
+	return node, nil
+}
+
+// Link creates a new hard link named req.NewName in the receiving directory
+// pointing at the existing file old.
+func (d *dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Link",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	oldFile, ok := old.(*file)
+	if !ok {
+		lgrEnd(d, nil, syscall.EINVAL)
+		return nil, syscall.EINVAL
+	}
+
+	fullPath := filepath.Join(d.path, req.NewName)
+
+	if err := d.HandlePre(ctx, &LinkEvent{Phase: "start", Dir: d, Name: req.NewName}); err != nil {
+		lgrEnd(d, nil, err)
+		return nil, err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, nil, fuse.Errno(syscall.EACCES))
+		return nil, fuse.Errno(syscall.EACCES)
+	}
+
+	err := os.Link(oldFile.path, fullPath)
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &LinkEvent{Phase: "end", Dir: d, Name: req.NewName, Err: translated})
+
+	if err != nil {
+		lgrEnd(d, nil, translated)
+		return nil, translated
+	}
+
+	d.cfg.cache.forgetPrefix(ctx, d.path)
+
+	node := d.FileFactory().NewFile(fullPath)
+
+	lgrEnd(d, node, nil)
+	return node, nil
+}
+
+// Getxattr reads the named extended attribute of the receiving directory.
+func (d *dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Getxattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
 	}
-	d.RData.lock.Unlock()
-	if err := saveMeta(d.Acc, d.RData); err != nil {
-		log.Error("Rename dir: cannot save Meta")
+
+	if err := d.HandlePre(ctx, &GetxattrEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, err)
 		return err
 	}
+
+	buf := make([]byte, req.Size)
+	n, err := unix.Getxattr(d.path, req.Name, buf)
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &GetxattrEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+
+	if err != nil {
+		lgrEnd(d, translated)
+		return translated
+	}
+	resp.Xattr = buf[:n]
+
+	lgrEnd(d, n, nil)
 	return nil
 }
-*/
+
+// Listxattr lists the extended attribute names set on the receiving
+// directory.
+func (d *dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Listxattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := d.HandlePre(ctx, &ListxattrEvent{Phase: "start", Dir: d}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
+
+	buf := make([]byte, req.Size)
+	n, err := unix.Listxattr(d.path, buf)
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &ListxattrEvent{Phase: "end", Dir: d, Err: translated})
+
+	if err != nil {
+		lgrEnd(d, translated)
+		return translated
+	}
+	resp.Xattr = buf[:n]
+
+	lgrEnd(d, n, nil)
+	return nil
+}
+
+// Setxattr sets an extended attribute on the receiving directory.
+func (d *dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Setxattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := d.HandlePre(ctx, &SetxattrEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	err := unix.Setxattr(d.path, req.Name, req.Xattr, int(req.Flags))
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &SetxattrEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+
+	lgrEnd(d, translated)
+	return translated
+}
+
+// Removexattr removes an extended attribute from the receiving directory.
+func (d *dir) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "dir",
+		"Func":     "Removexattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := d.HandlePre(ctx, &RemovexattrEvent{Phase: "start", Dir: d, Name: req.Name}); err != nil {
+		lgrEnd(d, err)
+		return err
+	}
+
+	if d.cfg.readOnly {
+		lgrEnd(d, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	err := unix.Removexattr(d.path, req.Name)
+	translated := d.translate(ctx, err)
+
+	d.HandlePost(ctx, &RemovexattrEvent{Phase: "end", Dir: d, Name: req.Name, Err: translated})
+
+	lgrEnd(d, translated)
+	return translated
+}
@@ -0,0 +1,72 @@
+package mirrorfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+)
+
+// ErrorEvent is fired whenever translateError maps an underlying OS/backend
+// error to a fuse.Errno, carrying both the original and translated error so
+// operators can debug misclassifications.
+type ErrorEvent struct {
+	Original   error
+	Translated error
+}
+
+func (e *ErrorEvent) EventName() string { return "error" }
+
+// translateError maps err, as returned by the os/syscall packages, to the
+// fuse.Errno a FUSE client expects. os.PathError and os.LinkError are
+// unwrapped to the syscall.Errno they carry; anything else is classified via
+// the os.Is* helpers, falling back to EIO rather than the blanket ENOENT this
+// replaces. A nil err returns nil.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return fuse.Errno(errno)
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return translateError(pathErr.Err)
+	}
+
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return translateError(linkErr.Err)
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		return fuse.Errno(syscall.ENOENT)
+	case os.IsExist(err):
+		return fuse.Errno(syscall.EEXIST)
+	case os.IsPermission(err):
+		return fuse.Errno(syscall.EACCES)
+	default:
+		return fuse.Errno(syscall.EIO)
+	}
+}
+
+// translate runs err through translateError and, when err is non-nil,
+// reports the original/translated pair via an "error" hook event. FUSE
+// methods call this (through their embedded HookHandler) instead of
+// returning an OS/backend error straight to bazil.org/fuse.
+func (hh HookHandler) translate(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	translated := translateError(err)
+	hh.HandlePost(ctx, &ErrorEvent{Original: err, Translated: translated})
+	return translated
+}
@@ -0,0 +1,117 @@
+package mirrorfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want fuse.Errno
+	}{
+		{name: "nil error stays nil", err: nil, want: 0},
+		{name: "bare syscall.Errno", err: syscall.ENOTDIR, want: fuse.Errno(syscall.ENOTDIR)},
+		{
+			name: "os.PathError unwraps to its errno",
+			err:  &os.PathError{Op: "stat", Path: "/a", Err: syscall.ENOENT},
+			want: fuse.Errno(syscall.ENOENT),
+		},
+		{
+			name: "os.LinkError unwraps to its errno",
+			err:  &os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.ENOTEMPTY},
+			want: fuse.Errno(syscall.ENOTEMPTY),
+		},
+		{
+			name: "wrapped os.PathError still unwraps",
+			err:  errWrap{&os.PathError{Op: "open", Path: "/a", Err: syscall.EACCES}},
+			want: fuse.Errno(syscall.EACCES),
+		},
+		{name: "os.ErrNotExist falls back to ENOENT", err: os.ErrNotExist, want: fuse.Errno(syscall.ENOENT)},
+		{name: "os.ErrExist falls back to EEXIST", err: os.ErrExist, want: fuse.Errno(syscall.EEXIST)},
+		{name: "os.ErrPermission falls back to EACCES", err: os.ErrPermission, want: fuse.Errno(syscall.EACCES)},
+		{name: "unrecognized error falls back to EIO", err: errors.New("boom"), want: fuse.Errno(syscall.EIO)},
+		{name: "ENOTSUP passes through untranslated", err: syscall.ENOTSUP, want: fuse.Errno(syscall.ENOTSUP)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+
+			if tt.err == nil {
+				if got != nil {
+					t.Fatalf("translateError(nil) = %v, want nil", got)
+				}
+				return
+			}
+
+			errno, ok := got.(fuse.Errno)
+			if !ok {
+				t.Fatalf("translateError(%v) = %v (%T), want fuse.Errno", tt.err, got, got)
+			}
+			if errno != tt.want {
+				t.Errorf("translateError(%v) = %v, want %v", tt.err, errno, tt.want)
+			}
+		})
+	}
+}
+
+// errWrap wraps an error with errors.Unwrap support, for exercising
+// translateError's errors.As-based unwrapping independent of os/syscall's
+// own wrapper types.
+type errWrap struct {
+	err error
+}
+
+func (e errWrap) Error() string { return e.err.Error() }
+func (e errWrap) Unwrap() error { return e.err }
+
+func TestHookHandlerTranslateFiresErrorEvent(t *testing.T) {
+	var got *ErrorEvent
+
+	hooks := NewHookHandler()
+	hooks.Register("error", func(ctx context.Context, event Event) error {
+		got = event.(*ErrorEvent)
+		return nil
+	})
+
+	original := syscall.ENOENT
+	translated := hooks.translate(context.Background(), original)
+
+	if translated != fuse.Errno(syscall.ENOENT) {
+		t.Fatalf("translate() = %v, want %v", translated, fuse.Errno(syscall.ENOENT))
+	}
+	if got == nil {
+		t.Fatal("expected an ErrorEvent to be fired")
+	}
+	if got.Original != error(original) {
+		t.Errorf("ErrorEvent.Original = %v, want %v", got.Original, original)
+	}
+	if got.Translated != translated {
+		t.Errorf("ErrorEvent.Translated = %v, want %v", got.Translated, translated)
+	}
+}
+
+func TestHookHandlerTranslateNilIsNoop(t *testing.T) {
+	called := false
+
+	hooks := NewHookHandler()
+	hooks.Register("error", func(ctx context.Context, event Event) error {
+		called = true
+		return nil
+	})
+
+	if err := hooks.translate(context.Background(), nil); err != nil {
+		t.Fatalf("translate(nil) = %v, want nil", err)
+	}
+	if called {
+		t.Error("translate(nil) should not fire an error event")
+	}
+}
@@ -0,0 +1,242 @@
+package mirrorfs
+
+import (
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// Event is implemented by every typed hook event. EventName is the name used
+// for glob-style subscription (e.g. "Lookup:start", "Write:end", "*").
+//
+// An operation fires two events: a "start" event before the underlying work
+// happens, and an "end" event after. An operation stopped before that work,
+// by a pre-hook or, on a dir or file, by a read-only mount, fires no "end"
+// event. A hook registered against a
+// "start" event runs synchronously and, if it returns a non-nil error, that
+// error short-circuits the operation instead of it ever touching the
+// underlying filesystem. Hooks registered against an "end" event run
+// concurrently, as observers only: their return value is ignored, since the
+// operation they're reporting on has already completed.
+type Event interface {
+	EventName() string
+}
+
+// LookupEvent is fired by dir.Lookup.
+type LookupEvent struct {
+	Phase  string
+	Dir    *dir
+	Name   string
+	Result fs.Node
+	Err    error
+}
+
+func (e *LookupEvent) EventName() string { return "Lookup:" + e.Phase }
+
+// ReadDirAllEvent is fired by dir.ReadDirAll.
+type ReadDirAllEvent struct {
+	Phase   string
+	Dir     *dir
+	Entries []fuse.Dirent
+	Err     error
+}
+
+func (e *ReadDirAllEvent) EventName() string { return "ReadDirAll:" + e.Phase }
+
+// AttrEvent is fired by dir.Attr and file.Attr.
+type AttrEvent struct {
+	Phase string
+	Dir   *dir
+	File  *file
+	Err   error
+}
+
+func (e *AttrEvent) EventName() string { return "Attr:" + e.Phase }
+
+// SetattrEvent is fired by dir.Setattr.
+type SetattrEvent struct {
+	Phase   string
+	Dir     *dir
+	Request *fuse.SetattrRequest
+	Err     error
+}
+
+func (e *SetattrEvent) EventName() string { return "Setattr:" + e.Phase }
+
+// CreateEvent is fired by dir.Create.
+type CreateEvent struct {
+	Phase string
+	Dir   *dir
+	Name  string
+	Node  interface{}
+	Err   error
+}
+
+func (e *CreateEvent) EventName() string { return "Create:" + e.Phase }
+
+// RemoveEvent is fired by dir.Remove.
+type RemoveEvent struct {
+	Phase string
+	Dir   *dir
+	Name  string
+	Err   error
+}
+
+func (e *RemoveEvent) EventName() string { return "Remove:" + e.Phase }
+
+// MkdirEvent is fired by dir.Mkdir.
+type MkdirEvent struct {
+	Phase string
+	Dir   *dir
+	Name  string
+	Node  interface{}
+	Err   error
+}
+
+func (e *MkdirEvent) EventName() string { return "Mkdir:" + e.Phase }
+
+// RenameEvent is fired by dir.Rename.
+type RenameEvent struct {
+	Phase   string
+	Dir     *dir
+	OldPath string
+	NewPath string
+	Err     error
+}
+
+func (e *RenameEvent) EventName() string { return "Rename:" + e.Phase }
+
+// SymlinkEvent is fired by dir.Symlink.
+type SymlinkEvent struct {
+	Phase  string
+	Dir    *dir
+	Name   string
+	Target string
+	Err    error
+}
+
+func (e *SymlinkEvent) EventName() string { return "Symlink:" + e.Phase }
+
+// ReadlinkEvent is fired by symlink.Readlink.
+type ReadlinkEvent struct {
+	Phase  string
+	Target string
+	Err    error
+}
+
+func (e *ReadlinkEvent) EventName() string { return "Readlink:" + e.Phase }
+
+// LinkEvent is fired by dir.Link.
+type LinkEvent struct {
+	Phase string
+	Dir   *dir
+	Name  string
+	Err   error
+}
+
+func (e *LinkEvent) EventName() string { return "Link:" + e.Phase }
+
+// OpenEvent is fired by file.Open.
+type OpenEvent struct {
+	Phase string
+	File  *file
+	Flags fuse.OpenFlags
+	Err   error
+}
+
+func (e *OpenEvent) EventName() string { return "Open:" + e.Phase }
+
+// ReadEvent is fired by fileHandle.Read.
+type ReadEvent struct {
+	Phase  string
+	File   *file
+	Offset int64
+	Size   int
+	Bytes  int
+	Err    error
+}
+
+func (e *ReadEvent) EventName() string { return "Read:" + e.Phase }
+
+// WriteEvent is fired by fileHandle.Write.
+type WriteEvent struct {
+	Phase  string
+	File   *file
+	Offset int64
+	Data   []byte
+	Bytes  int
+	Err    error
+}
+
+func (e *WriteEvent) EventName() string { return "Write:" + e.Phase }
+
+// ReleaseEvent is fired by fileHandle.Release.
+type ReleaseEvent struct {
+	Phase string
+	File  *file
+	Err   error
+}
+
+func (e *ReleaseEvent) EventName() string { return "Release:" + e.Phase }
+
+// GetxattrEvent is fired by dir.Getxattr and file.Getxattr.
+type GetxattrEvent struct {
+	Phase string
+	Dir   *dir
+	File  *file
+	Name  string
+	Err   error
+}
+
+func (e *GetxattrEvent) EventName() string { return "Getxattr:" + e.Phase }
+
+// ListxattrEvent is fired by dir.Listxattr and file.Listxattr.
+type ListxattrEvent struct {
+	Phase string
+	Dir   *dir
+	File  *file
+	Err   error
+}
+
+func (e *ListxattrEvent) EventName() string { return "Listxattr:" + e.Phase }
+
+// SetxattrEvent is fired by dir.Setxattr and file.Setxattr.
+type SetxattrEvent struct {
+	Phase string
+	Dir   *dir
+	File  *file
+	Name  string
+	Err   error
+}
+
+func (e *SetxattrEvent) EventName() string { return "Setxattr:" + e.Phase }
+
+// RemovexattrEvent is fired by dir.Removexattr and file.Removexattr.
+type RemovexattrEvent struct {
+	Phase string
+	Dir   *dir
+	File  *file
+	Name  string
+	Err   error
+}
+
+func (e *RemovexattrEvent) EventName() string { return "Removexattr:" + e.Phase }
+
+// CacheEvent is fired by the attribute cache on a hit, miss, or explicit
+// forget. Kind is "attr" or "dirents"; Outcome is "hit", "miss", or "forget".
+type CacheEvent struct {
+	Outcome string
+	Kind    string
+	Key     string
+}
+
+func (e *CacheEvent) EventName() string { return "cache:" + e.Outcome }
+
+// UpstreamRouteEvent is fired by a combine mirror's root whenever it routes
+// an operation to one of its named upstreams.
+type UpstreamRouteEvent struct {
+	Op   string
+	Name string
+	Path string
+}
+
+func (e *UpstreamRouteEvent) EventName() string { return "upstream:route" }
@@ -1,11 +1,12 @@
 package mirrorfs
 
 import (
-	"io/ioutil"
+	"io"
 	"os"
 	"syscall"
 
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -21,12 +22,23 @@ type FileFactory interface {
 // reference to a set of hook handlers.
 type fileFactory struct {
 	hooks HookHandler
+	cfg   *fsConfig
 }
 
 // NewFileFactory creates a FileFactory with the given HookHandler.
 func NewFileFactory(hh HookHandler) FileFactory {
 	return &fileFactory{
 		hooks: hh,
+		cfg:   &fsConfig{},
+	}
+}
+
+// NewFileFactoryWithConfig creates a FileFactory with the given HookHandler
+// whose files share the given fsConfig.
+func NewFileFactoryWithConfig(hh HookHandler, cfg *fsConfig) FileFactory {
+	return &fileFactory{
+		hooks: hh,
+		cfg:   cfg,
 	}
 }
 
@@ -35,6 +47,7 @@ func (ff *fileFactory) NewFile(path string) File {
 	return &file{
 		path:        path,
 		HookHandler: ff.hooks,
+		cfg:         ff.cfg,
 	}
 }
 
@@ -42,8 +55,7 @@ func (ff *fileFactory) NewFile(path string) File {
 type File interface {
 	fs.Node
 	fs.Handle
-
-	EventHandler
+	fs.NodeOpener
 }
 
 // file is our internal file reference that can handle events.
@@ -51,12 +63,7 @@ type file struct {
 	HookHandler
 
 	path string
-}
-
-// HandleEvent is passes the event and the given data to our HookHandler for
-// processing.
-func (f *file) HandleEvent(event string, data interface{}) {
-	f.HookHandler.Handle(event, data)
+	cfg  *fsConfig
 }
 
 // Attr returns sets the attributes for the current file receiver on the given
@@ -75,22 +82,19 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 		lgr.Debug("end", data)
 	}
 
-	f.Handle("Attr:start", map[string]interface{}{
-		"file":    f,
-		"context": ctx,
-		"attr":    a,
-	})
+	if err := f.HandlePre(ctx, &AttrEvent{Phase: "start", File: f}); err != nil {
+		lgrEnd(f, err)
+		return err
+	}
 
 	fileInfo, err := os.Stat(f.path)
 	if err != nil {
-		f.Handle("Attr:end", map[string]interface{}{
-			"file":  f,
-			"error": err,
-		})
+		translated := f.translate(ctx, err)
+		f.HandlePost(ctx, &AttrEvent{Phase: "end", File: f, Err: translated})
 
-		lgrEnd(f, err)
+		lgrEnd(f, translated)
 
-		return syscall.ENOENT
+		return translated
 	}
 
 	a.Size = uint64(fileInfo.Size())
@@ -103,118 +107,273 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = stat.Ino
 	a.Mode = fileInfo.Mode()
 
-	f.Handle("Attr:end", map[string]interface{}{
-		"file":  f,
-		"error": nil,
-	})
+	f.HandlePost(ctx, &AttrEvent{Phase: "end", File: f})
 
 	lgrEnd(f, nil)
 	return nil
 }
 
-/*
-// Open opens the file for reading.
-func (f *File) Open(
-	ctx context.Context,
-	req *fuse.OpenRequest,
-	resp *fuse.OpenResponse,
-) (fs.Handle,error) {
+// Open opens the underlying OS file once for this FUSE open and returns a
+// fileHandle that serves subsequent Read/Write/Release calls via pread/pwrite
+// on that fd, rather than the whole-file ReadAll/reopen-per-Write path this
+// replaces.
+func (f *file) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "file",
+		"Func":     "Open",
+	})
+	lgr.Debug("start", []interface{}{
+		f,
+		ctx,
+		req,
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := f.HandlePre(ctx, &OpenEvent{Phase: "start", File: f, Flags: req.Flags}); err != nil {
+		lgrEnd(f, err)
+		return nil, err
+	}
 
+	if f.cfg.readOnly && (req.Flags.IsWriteOnly() || req.Flags.IsReadWrite()) {
+		lgrEnd(f, fuse.Errno(syscall.EACCES))
+		return nil, fuse.Errno(syscall.EACCES)
+	}
 
-	fsHandler, err := os.OpenFile(f.path, int(req.Flags), f.attr.Mode)
+	osFile, err := os.OpenFile(f.path, int(req.Flags), 0)
 	if err != nil {
+		translated := f.translate(ctx, err)
+		f.HandlePost(ctx, &OpenEvent{Phase: "end", File: f, Flags: req.Flags, Err: translated})
 
-		return nil, err
+		lgrEnd(f, translated)
+		return nil, translated
 	}
-	f.handler = fsHandler
 
+	f.HandlePost(ctx, &OpenEvent{Phase: "end", File: f, Flags: req.Flags})
+
+	lgrEnd(f, nil)
 
-	return f, nil
+	return &fileHandle{
+		HookHandler: f.HookHandler,
+		file:        f,
+		osFile:      osFile,
+	}, nil
 }
-*/
 
-// ReadAll reads the contents of the current file receiver.
-func (f *file) ReadAll(ctx context.Context) ([]byte, error) {
+// Getxattr reads the named extended attribute of the receiving file.
+func (f *file) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
 	lgr := loggerWith(map[string]interface{}{
 		"Receiver": "file",
-		"Func":     "ReadAll",
-	})
-	lgr.Debug("start", []interface{}{
-		f,
-		ctx,
+		"Func":     "Getxattr",
 	})
 	lgrEnd := func(data ...interface{}) {
 		lgr.Debug("end", data)
 	}
 
-	f.Handle("ReadAll:start", map[string]interface{}{
-		"file":    f,
-		"context": ctx,
-	})
+	if err := f.HandlePre(ctx, &GetxattrEvent{Phase: "start", File: f, Name: req.Name}); err != nil {
+		lgrEnd(f, err)
+		return err
+	}
 
-	data, err := ioutil.ReadFile(f.path)
+	buf := make([]byte, req.Size)
+	n, err := unix.Getxattr(f.path, req.Name, buf)
+	translated := f.translate(ctx, err)
 
-	f.Handle("ReadAll:end", map[string]interface{}{
-		"file":    f,
-		"content": data,
-		"error":   err,
-	})
+	f.HandlePost(ctx, &GetxattrEvent{Phase: "end", File: f, Name: req.Name, Err: translated})
 
-	lgrEnd(f, data, err)
-	return data, err
+	if err != nil {
+		lgrEnd(f, translated)
+		return translated
+	}
+	resp.Xattr = buf[:n]
+
+	lgrEnd(f, n, nil)
+	return nil
 }
 
-// Write writes the data in the request to the underlying file in an appending
-// fashion.
-func (f *file) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+// Listxattr lists the extended attribute names set on the receiving file.
+func (f *file) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
 	lgr := loggerWith(map[string]interface{}{
 		"Receiver": "file",
-		"Func":     "Write",
-	})
-	lgr.Debug("start", []interface{}{
-		f,
-		ctx,
+		"Func":     "Listxattr",
 	})
 	lgrEnd := func(data ...interface{}) {
 		lgr.Debug("end", data)
 	}
 
-	f.Handle("Write:start", map[string]interface{}{
-		"file":     f,
-		"context":  ctx,
-		"request":  req,
-		"response": resp,
-	})
-
-	fInfo, err := os.Stat(f.path)
-	if err != nil {
+	if err := f.HandlePre(ctx, &ListxattrEvent{Phase: "start", File: f}); err != nil {
 		lgrEnd(f, err)
 		return err
 	}
 
-	file, err := os.OpenFile(f.path, int(req.Flags)|os.O_WRONLY, fInfo.Mode())
+	buf := make([]byte, req.Size)
+	n, err := unix.Listxattr(f.path, buf)
+	translated := f.translate(ctx, err)
+
+	f.HandlePost(ctx, &ListxattrEvent{Phase: "end", File: f, Err: translated})
+
 	if err != nil {
+		lgrEnd(f, translated)
+		return translated
+	}
+	resp.Xattr = buf[:n]
+
+	lgrEnd(f, n, nil)
+	return nil
+}
+
+// Setxattr sets an extended attribute on the receiving file.
+func (f *file) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "file",
+		"Func":     "Setxattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := f.HandlePre(ctx, &SetxattrEvent{Phase: "start", File: f, Name: req.Name}); err != nil {
 		lgrEnd(f, err)
 		return err
 	}
 
-	bytesWritten, err := file.WriteAt(req.Data, req.Offset)
-	if err != nil {
+	if f.cfg.readOnly {
+		lgrEnd(f, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	err := unix.Setxattr(f.path, req.Name, req.Xattr, int(req.Flags))
+	translated := f.translate(ctx, err)
+
+	f.HandlePost(ctx, &SetxattrEvent{Phase: "end", File: f, Name: req.Name, Err: translated})
+
+	lgrEnd(f, translated)
+	return translated
+}
+
+// Removexattr removes an extended attribute from the receiving file.
+func (f *file) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "file",
+		"Func":     "Removexattr",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := f.HandlePre(ctx, &RemovexattrEvent{Phase: "start", File: f, Name: req.Name}); err != nil {
 		lgrEnd(f, err)
 		return err
-	} else if err := file.Close(); err != nil {
-		lgrEnd(f, err)
+	}
+
+	if f.cfg.readOnly {
+		lgrEnd(f, fuse.Errno(syscall.EACCES))
+		return fuse.Errno(syscall.EACCES)
+	}
+
+	err := unix.Removexattr(f.path, req.Name)
+	translated := f.translate(ctx, err)
+
+	f.HandlePost(ctx, &RemovexattrEvent{Phase: "end", File: f, Name: req.Name, Err: translated})
+
+	lgrEnd(f, translated)
+	return translated
+}
+
+// fileHandle is the per-open handle returned by file.Open. It owns the
+// underlying *os.File for the lifetime of the open and serves Read/Write via
+// ReadAt/WriteAt on that fd.
+type fileHandle struct {
+	HookHandler
+
+	file   *file
+	osFile *os.File
+}
+
+// Read reads from the handle's open fd at the requested offset.
+func (fh *fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "fileHandle",
+		"Func":     "Read",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := fh.HandlePre(ctx, &ReadEvent{Phase: "start", File: fh.file, Offset: req.Offset, Size: req.Size}); err != nil {
+		lgrEnd(fh, err)
 		return err
 	}
 
-	resp.Size = int(req.Offset) + bytesWritten
+	buf := make([]byte, req.Size)
+	n, err := fh.osFile.ReadAt(buf, req.Offset)
+	if err != nil && err != io.EOF {
+		translated := fh.translate(ctx, err)
+		fh.HandlePost(ctx, &ReadEvent{Phase: "end", File: fh.file, Offset: req.Offset, Size: req.Size, Err: translated})
+
+		lgrEnd(fh, translated)
+		return translated
+	}
+	resp.Data = buf[:n]
 
-	f.Handle("Write:end", map[string]interface{}{
-		"file":  f,
-		"error": err,
+	fh.HandlePost(ctx, &ReadEvent{Phase: "end", File: fh.file, Offset: req.Offset, Size: req.Size, Bytes: n})
+
+	lgrEnd(fh, n, nil)
+	return nil
+}
+
+// Write writes to the handle's open fd at the requested offset.
+func (fh *fileHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "fileHandle",
+		"Func":     "Write",
 	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
 
-	lgrEnd(f, nil)
+	if err := fh.HandlePre(ctx, &WriteEvent{Phase: "start", File: fh.file, Offset: req.Offset, Data: req.Data}); err != nil {
+		lgrEnd(fh, err)
+		return err
+	}
+
+	n, err := fh.osFile.WriteAt(req.Data, req.Offset)
+	if err != nil {
+		translated := fh.translate(ctx, err)
+		fh.HandlePost(ctx, &WriteEvent{Phase: "end", File: fh.file, Offset: req.Offset, Data: req.Data, Err: translated})
+
+		lgrEnd(fh, translated)
+		return translated
+	}
+	resp.Size = n
+
+	fh.HandlePost(ctx, &WriteEvent{Phase: "end", File: fh.file, Offset: req.Offset, Data: req.Data, Bytes: n})
+
+	lgrEnd(fh, n, nil)
 	return nil
+}
+
+// Release closes the handle's open fd.
+func (fh *fileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "fileHandle",
+		"Func":     "Release",
+	})
+	lgrEnd := func(data ...interface{}) {
+		lgr.Debug("end", data)
+	}
+
+	if err := fh.HandlePre(ctx, &ReleaseEvent{Phase: "start", File: fh.file}); err != nil {
+		lgrEnd(fh, err)
+		return err
+	}
+
+	err := fh.osFile.Close()
+	translated := fh.translate(ctx, err)
+
+	fh.HandlePost(ctx, &ReleaseEvent{Phase: "end", File: fh.file, Err: translated})
 
+	lgrEnd(fh, translated)
+	return translated
 }
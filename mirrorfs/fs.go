@@ -1,23 +1,136 @@
 package mirrorfs
 
 import (
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/net/context"
 
 	"bazil.org/fuse/fs"
 )
 
+// DefaultAttrTimeout is the TTL applied to cached directory entries and stat
+// results when an FS is created without WithAttrTimeout.
+const DefaultAttrTimeout = time.Second
+
 // FS implements the hello world file system.
 type FS interface {
 	Root() (fs.Node, error)
 	RootPath() string
 	WithHook(event string, hook HookFN) FS
+
+	// Upstreams returns the set of named upstream roots backing this FS. For
+	// an FS created with NewMirrorFS (a single root), this returns nil.
+	Upstreams() UpstreamMap
+
+	// ForgetAll drops every cached directory listing and stat result.
+	ForgetAll()
+	// ForgetPath drops cached entries for the given path, relative to the FS
+	// root (or, for a combine mirror, relative to every upstream root), along
+	// with any cached descendants.
+	ForgetPath(rel string)
+}
+
+// UpstreamMap names the backing source roots for a combine mirror, e.g.
+// `UpstreamMap{"photos": "/mnt/a/pictures", "docs": "/mnt/b/documents"}`.
+// Each key is presented as a top-level directory at the mount point.
+type UpstreamMap map[string]string
+
+// CollisionPolicy controls how a combine mirror resolves a Mkdir at its root
+// whose name collides with an already configured upstream. A colliding Create
+// fails with EISDIR under either policy, since every upstream is a directory.
+type CollisionPolicy int
+
+const (
+	// FirstWriterWins treats a colliding Mkdir as a no-op, returning the
+	// existing upstream node rather than an error.
+	FirstWriterWins CollisionPolicy = iota
+	// ErrorOnCollision rejects a colliding Mkdir with EEXIST.
+	ErrorOnCollision
+)
+
+// Option configures an FS returned by NewMirrorFS or NewCombineMirrorFS.
+type Option func(*mirrorFS)
+
+// WithCollisionPolicy sets the CollisionPolicy used by a combine mirror when
+// a Mkdir at its root collides with a configured upstream name. It has
+// no effect on an FS created with NewMirrorFS.
+func WithCollisionPolicy(policy CollisionPolicy) Option {
+	return func(m *mirrorFS) {
+		m.collision = policy
+	}
 }
 
-type HookFN func(data interface{})
-type HookHandler map[string][]HookFN
+// WithAttrTimeout sets how long directory entries and stat results stay
+// cached before being re-stat'd. A non-positive timeout disables caching.
+func WithAttrTimeout(timeout time.Duration) Option {
+	return func(m *mirrorFS) {
+		m.attrTimeout = timeout
+	}
+}
 
-func (hh HookHandler) Register(event string, fn HookFN) {
-	hh[event] = append(hh[event], fn)
+// WithReadOnly mounts the FS read-only: Open rejects write access, and
+// Create/Mkdir/Remove are rejected with EACCES.
+func WithReadOnly(readOnly bool) Option {
+	return func(m *mirrorFS) {
+		m.readOnly = readOnly
+	}
+}
+
+// fsConfig bundles the read-time configuration shared by every dir/file
+// spawned from a single FS tree.
+type fsConfig struct {
+	cache    *attrCache
+	readOnly bool
+}
+
+// HookFN is a hook callback registered against one or more event name
+// patterns. It receives the context associated with the operation and the
+// typed Event describing it.
+//
+// A HookFN registered against an operation's "start" event (a pre-hook) runs
+// synchronously; if it returns a non-nil error, that error short-circuits
+// the operation and is returned to the caller in its place, letting hooks
+// implement authorization, quotas, or write shaping. A HookFN registered
+// against an "end" event (a post-hook) runs concurrently with the other
+// post-hooks for that event, as an observer only: its return value is
+// ignored, since the operation it describes has already completed.
+type HookFN func(ctx context.Context, event Event) error
+
+// hookEntry pairs a glob-style event name pattern with the hook registered
+// against it.
+type hookEntry struct {
+	pattern string
+	fn      HookFN
+}
+
+// hookRegistry is the shared, mutable backing store for a HookHandler. It is
+// only ever referenced through a pointer, so every dir/file/comboDir spawned
+// from the same FS sees hooks registered on any of the others.
+type hookRegistry struct {
+	mu    sync.RWMutex
+	hooks []hookEntry
+}
+
+// HookHandler dispatches typed Events to hooks registered against
+// glob-style event name patterns, e.g. "Lookup:*" or "*". It is cheap to
+// copy: every copy shares the same underlying registry.
+type HookHandler struct {
+	reg *hookRegistry
+}
+
+// NewHookHandler creates an empty HookHandler.
+func NewHookHandler() HookHandler {
+	return HookHandler{reg: &hookRegistry{}}
+}
+
+// Register subscribes fn to every event whose name matches pattern.
+func (hh HookHandler) Register(pattern string, fn HookFN) {
+	hh.reg.mu.Lock()
+	hh.reg.hooks = append(hh.reg.hooks, hookEntry{pattern: pattern, fn: fn})
+	hh.reg.mu.Unlock()
 }
 
 func (hh HookHandler) DirectoryFactory() DirectoryFactory {
@@ -28,54 +141,152 @@ func (hh HookHandler) FileFactory() FileFactory {
 	return NewFileFactory(hh)
 }
 
-func (hh HookHandler) Handle(event string, data interface{}) {
+// matchesPattern reports whether name is matched by the glob-style pattern:
+// "*" matches everything, a trailing "*" matches by prefix, and anything
+// else must match name exactly.
+func matchesPattern(pattern, name string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == name
+}
+
+func (hh HookHandler) matching(name string) []HookFN {
+	hh.reg.mu.RLock()
+	defer hh.reg.mu.RUnlock()
+
+	var fns []HookFN
+	for _, entry := range hh.reg.hooks {
+		if matchesPattern(entry.pattern, name) {
+			fns = append(fns, entry.fn)
+		}
+	}
+	return fns
+}
+
+// HandlePre runs every hook matching event.EventName() synchronously, in
+// registration order, stopping at the first one that returns a non-nil
+// error. That error short-circuits the operation the event describes.
+func (hh HookHandler) HandlePre(ctx context.Context, event Event) error {
 	lgr := loggerWith(map[string]interface{}{
 		"Receiver": "HookHandler",
-		"Func":     "Handle",
+		"Func":     "HandlePre",
 	})
+	lgr.Debug("start", event)
 
-	lgr.Debug("start")
-	globalFns, _ := hh["*"]
+	for _, fn := range hh.matching(event.EventName()) {
+		if err := fn(ctx, event); err != nil {
+			lgr.Debug("end", err)
+			return err
+		}
+	}
 
-	fns, exists := hh[event]
-	if (!exists || len(fns) == 0) && len(globalFns) == 0 {
+	lgr.Debug("end", nil)
+	return nil
+}
+
+// HandlePost runs every hook matching event.EventName() concurrently, as
+// observers: their errors are ignored, since the operation they're
+// reporting on has already completed.
+func (hh HookHandler) HandlePost(ctx context.Context, event Event) {
+	lgr := loggerWith(map[string]interface{}{
+		"Receiver": "HookHandler",
+		"Func":     "HandlePost",
+	})
+	lgr.Debug("start", event)
+
+	fns := hh.matching(event.EventName())
+	if len(fns) == 0 {
 		lgr.Debug("no funcs to run, exiting")
 		lgr.Debug("end")
 		return
 	}
 
-	fns = append(fns, globalFns...)
-
 	var wg sync.WaitGroup
 	for _, fn := range fns {
 		wg.Add(1)
-		go func(data interface{}) {
-			fn(data)
-			wg.Done()
-		}(data)
+		go func(fn HookFN) {
+			defer wg.Done()
+			fn(ctx, event)
+		}(fn)
 	}
-
 	wg.Wait()
 
 	lgr.Debug("end")
 }
 
 type mirrorFS struct {
-	root  string
-	hooks HookHandler
+	root      string
+	upstreams UpstreamMap
+	collision CollisionPolicy
+	hooks     HookHandler
+
+	attrTimeout time.Duration
+	cache       *attrCache
+	readOnly    bool
+}
+
+// NewMirrorFS creates an FS that mirrors the single source root at the given
+// path.
+func NewMirrorFS(root string, opts ...Option) FS {
+	m := &mirrorFS{
+		root:        root,
+		hooks:       NewHookHandler(),
+		attrTimeout: DefaultAttrTimeout,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.cache = newAttrCache(m.attrTimeout, m.hooks)
+	return m
 }
 
-func NewMirrorFS(root string) FS {
-	return &mirrorFS{
-		root:  root,
-		hooks: HookHandler{},
+// NewCombineMirrorFS creates an FS that unions multiple named source roots
+// under a single mount, e.g.
+//
+//	NewCombineMirrorFS(UpstreamMap{
+//		"photos": "/mnt/a/pictures",
+//		"docs":   "/mnt/b/documents",
+//	})
+//
+// presents "photos" and "docs" as top-level directories at the mount point,
+// each transparently backed by its mapped upstream root.
+func NewCombineMirrorFS(upstreams UpstreamMap, opts ...Option) FS {
+	m := &mirrorFS{
+		upstreams:   upstreams,
+		hooks:       NewHookHandler(),
+		attrTimeout: DefaultAttrTimeout,
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.cache = newAttrCache(m.attrTimeout, m.hooks)
+	return m
 }
 
 func (m *mirrorFS) Root() (fs.Node, error) {
-	return m.hooks.DirectoryFactory().NewDirectory(
-		m.root,
-	), nil
+	cfg := &fsConfig{
+		cache:    m.cache,
+		readOnly: m.readOnly,
+	}
+
+	if m.upstreams != nil {
+		return &comboDir{
+			HookHandler: m.hooks,
+			upstreams:   m.upstreams,
+			collision:   m.collision,
+			cfg:         cfg,
+		}, nil
+	}
+
+	return &dir{
+		HookHandler: m.hooks,
+		path:        m.root,
+		cfg:         cfg,
+	}, nil
 }
 
 func (m *mirrorFS) RootPath() string {
@@ -86,3 +297,30 @@ func (m *mirrorFS) WithHook(event string, hook HookFN) FS {
 	m.hooks.Register(event, hook)
 	return m
 }
+
+func (m *mirrorFS) Upstreams() UpstreamMap {
+	if m.upstreams == nil {
+		return nil
+	}
+
+	cp := make(UpstreamMap, len(m.upstreams))
+	for name, path := range m.upstreams {
+		cp[name] = path
+	}
+	return cp
+}
+
+func (m *mirrorFS) ForgetAll() {
+	m.cache.forgetAll(context.Background())
+}
+
+func (m *mirrorFS) ForgetPath(rel string) {
+	if m.upstreams != nil {
+		for _, path := range m.upstreams {
+			m.cache.forgetPrefix(context.Background(), filepath.Join(path, rel))
+		}
+		return
+	}
+
+	m.cache.forgetPrefix(context.Background(), filepath.Join(m.root, rel))
+}
@@ -0,0 +1,28 @@
+package mirrorfs
+
+import "testing"
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*", name: "Lookup:start", want: true},
+		{pattern: "*", name: "anything", want: true},
+		{pattern: "Lookup:*", name: "Lookup:start", want: true},
+		{pattern: "Lookup:*", name: "Lookup:end", want: true},
+		{pattern: "Lookup:*", name: "Mkdir:start", want: false},
+		{pattern: "Lookup:start", name: "Lookup:start", want: true},
+		{pattern: "Lookup:start", name: "Lookup:end", want: false},
+		{pattern: "cache:hit", name: "cache:miss", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.name, func(t *testing.T) {
+			if got := matchesPattern(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("matchesPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mirrorfs
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"bazil.org/fuse"
+)
+
+// symlink is our internal representation of a symbolic link on the mirrored
+// filesystem. Unlike dir and file it has no factory of its own: it is only
+// ever constructed by dir.Lookup, dir.ReadDirAll (indirectly), and
+// dir.Symlink, which already hold the path and HookHandler it needs.
+type symlink struct {
+	HookHandler
+
+	path string
+}
+
+// Attr sets the attributes for the receiving symlink on the given
+// `fuse.Attr`, using Lstat so the link itself (not its target) is reported.
+func (s *symlink) Attr(ctx context.Context, a *fuse.Attr) error {
+	fileInfo, err := os.Lstat(s.path)
+	if err != nil {
+		return s.translate(ctx, err)
+	}
+
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return syscall.ENOENT // find a valid error code for this
+	}
+	a.Inode = stat.Ino
+	a.Mode = fileInfo.Mode()
+	a.Size = uint64(fileInfo.Size())
+
+	return nil
+}
+
+// Readlink reads the target of the receiving symlink.
+func (s *symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	if err := s.HandlePre(ctx, &ReadlinkEvent{Phase: "start"}); err != nil {
+		return "", err
+	}
+
+	target, err := os.Readlink(s.path)
+	translated := s.translate(ctx, err)
+
+	s.HandlePost(ctx, &ReadlinkEvent{Phase: "end", Target: target, Err: translated})
+
+	if err != nil {
+		return "", translated
+	}
+	return target, nil
+}